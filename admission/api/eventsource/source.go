@@ -0,0 +1,125 @@
+/*
+Copyright The Kmodules Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package eventsource adapts an api.ResourceHandler so it can be plugged
+// into either a raw SharedIndexInformer or a controller-runtime Controller,
+// without the handler's notification code having to know which one it's
+// wired to.
+package eventsource
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	crhandler "sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	"kmodules.xyz/client-go/admission/api"
+)
+
+// AsResourceEventHandler adapts h into a cache.ResourceEventHandler that can
+// be registered directly on a SharedIndexInformer, for callers that aren't
+// using controller-runtime. ctx is passed to every notification; errors
+// returned by h are reported through runtime.HandleError since
+// cache.ResourceEventHandler has no return value to surface them through.
+func AsResourceEventHandler(ctx context.Context, h api.ResourceHandler) cache.ResourceEventHandler {
+	return &resourceEventHandler{ctx: ctx, handler: h}
+}
+
+type resourceEventHandler struct {
+	ctx     context.Context
+	handler api.ResourceHandler
+}
+
+func (e *resourceEventHandler) OnAdd(obj interface{}) {
+	if _, err := e.handler.OnAdd(e.ctx, obj); err != nil {
+		runtime.HandleError(err)
+	}
+}
+
+func (e *resourceEventHandler) OnUpdate(oldObj, newObj interface{}) {
+	if _, err := e.handler.OnUpdate(e.ctx, oldObj, newObj); err != nil {
+		runtime.HandleError(err)
+	}
+}
+
+func (e *resourceEventHandler) OnDelete(obj interface{}) {
+	if err := e.handler.OnDelete(e.ctx, obj); err != nil {
+		runtime.HandleError(err)
+	}
+}
+
+// Source adapts Handler into a sigs.k8s.io/controller-runtime/pkg/source.Source
+// backed by Informer. Registering it on a Controller via Controller.Watch
+// keeps Handler getting its OnAdd/OnUpdate/OnDelete notifications exactly
+// like AsResourceEventHandler would, while also enqueuing an
+// event.GenericEvent for every object whose notification returned no error
+// and that passes the predicates, so the Controller reconciles it.
+type Source struct {
+	Informer cache.SharedIndexInformer
+	Handler  api.ResourceHandler
+}
+
+// Start implements source.Source.
+func (s *Source) Start(ctx context.Context, h crhandler.EventHandler, q workqueue.RateLimitingInterface, preds ...predicate.Predicate) error {
+	s.Informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if _, err := s.Handler.OnAdd(ctx, obj); err != nil {
+				runtime.HandleError(err)
+				return
+			}
+			s.enqueue(ctx, h, q, preds, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if _, err := s.Handler.OnUpdate(ctx, oldObj, newObj); err != nil {
+				runtime.HandleError(err)
+				return
+			}
+			s.enqueue(ctx, h, q, preds, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if err := s.Handler.OnDelete(ctx, obj); err != nil {
+				runtime.HandleError(err)
+				return
+			}
+			s.enqueue(ctx, h, q, preds, obj)
+		},
+	})
+	return nil
+}
+
+// enqueue turns obj into an event.GenericEvent, runs it past preds, and hands it to
+// h so the Controller that owns q reconciles it.
+func (s *Source) enqueue(ctx context.Context, h crhandler.EventHandler, q workqueue.RateLimitingInterface, preds []predicate.Predicate, obj interface{}) {
+	o, ok := obj.(client.Object)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("eventsource: expected client.Object, got %T", obj))
+		return
+	}
+
+	evt := event.GenericEvent{Object: o}
+	for _, p := range preds {
+		if !p.Generic(evt) {
+			return
+		}
+	}
+	h.Generic(ctx, evt, q)
+}
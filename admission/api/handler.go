@@ -1,5 +1,7 @@
 package api
 
+import "context"
+
 // ResourceHandler can handle notifications for events that happen to a
 // resource. The events are informational only, so you can't return an
 // error.
@@ -14,41 +16,82 @@ package api
 //      it will get an object of type DeletedFinalStateUnknown. This can
 //      happen if the watch is closed and misses the delete event and we don't
 //      notice the deletion until the subsequent re-list.
+// ctx is the context the notification was dispatched with; handlers that
+// start background work from a callback should derive from it so that work
+// gets cancelled along with the watch/reconcile that triggered it.
 type ResourceHandler interface {
-	OnAdd(obj interface{}) (interface{}, error)
-	OnUpdate(oldObj, newObj interface{}) (interface{}, error)
-	OnDelete(obj interface{}) error
+	OnAdd(ctx context.Context, obj interface{}) (interface{}, error)
+	OnUpdate(ctx context.Context, oldObj, newObj interface{}) (interface{}, error)
+	OnDelete(ctx context.Context, obj interface{}) error
 }
 
 // ResourceHandlerFuncs is an adaptor to let you easily specify as many or
 // as few of the notification functions as you want while still implementing
 // ResourceHandler.
 type ResourceHandlerFuncs struct {
-	AddFunc    func(obj interface{}) (interface{}, error)
-	UpdateFunc func(oldObj, newObj interface{}) (interface{}, error)
-	DeleteFunc func(obj interface{}) error
+	AddFunc    func(ctx context.Context, obj interface{}) (interface{}, error)
+	UpdateFunc func(ctx context.Context, oldObj, newObj interface{}) (interface{}, error)
+	DeleteFunc func(ctx context.Context, obj interface{}) error
 }
 
 // OnAdd calls AddFunc if it's not nil.
-func (r ResourceHandlerFuncs) OnAdd(obj interface{}) (interface{}, error) {
+func (r ResourceHandlerFuncs) OnAdd(ctx context.Context, obj interface{}) (interface{}, error) {
 	if r.AddFunc != nil {
-		return r.AddFunc(obj)
+		return r.AddFunc(ctx, obj)
 	}
 	return nil, nil
 }
 
 // OnUpdate calls UpdateFunc if it's not nil.
-func (r ResourceHandlerFuncs) OnUpdate(oldObj, newObj interface{}) (interface{}, error) {
+func (r ResourceHandlerFuncs) OnUpdate(ctx context.Context, oldObj, newObj interface{}) (interface{}, error) {
 	if r.UpdateFunc != nil {
-		return r.UpdateFunc(oldObj, newObj)
+		return r.UpdateFunc(ctx, oldObj, newObj)
 	}
 	return nil, nil
 }
 
 // OnDelete calls DeleteFunc if it's not nil.
-func (r ResourceHandlerFuncs) OnDelete(obj interface{}) error {
+func (r ResourceHandlerFuncs) OnDelete(ctx context.Context, obj interface{}) error {
 	if r.DeleteFunc != nil {
-		return r.DeleteFunc(obj)
+		return r.DeleteFunc(ctx, obj)
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// LegacyResourceHandler is the pre-context ResourceHandler signature that
+// this package exposed before callers could thread a context.Context through
+// notifications.
+//
+// Deprecated: implement ResourceHandler instead. Use WrapLegacy to adapt an
+// existing LegacyResourceHandler until it's migrated.
+type LegacyResourceHandler interface {
+	OnAdd(obj interface{}) (interface{}, error)
+	OnUpdate(oldObj, newObj interface{}) (interface{}, error)
+	OnDelete(obj interface{}) error
+}
+
+// legacyResourceHandlerAdapter adapts a LegacyResourceHandler to
+// ResourceHandler by discarding the context passed to each method.
+type legacyResourceHandlerAdapter struct {
+	LegacyResourceHandler
+}
+
+func (a legacyResourceHandlerAdapter) OnAdd(_ context.Context, obj interface{}) (interface{}, error) {
+	return a.LegacyResourceHandler.OnAdd(obj)
+}
+
+func (a legacyResourceHandlerAdapter) OnUpdate(_ context.Context, oldObj, newObj interface{}) (interface{}, error) {
+	return a.LegacyResourceHandler.OnUpdate(oldObj, newObj)
+}
+
+func (a legacyResourceHandlerAdapter) OnDelete(_ context.Context, obj interface{}) error {
+	return a.LegacyResourceHandler.OnDelete(obj)
+}
+
+// WrapLegacy adapts h to the context-aware ResourceHandler interface,
+// discarding whatever context it's called with before invoking h.
+//
+// Deprecated: update h to implement ResourceHandler directly.
+func WrapLegacy(h LegacyResourceHandler) ResourceHandler {
+	return legacyResourceHandlerAdapter{h}
+}
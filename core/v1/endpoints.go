@@ -17,57 +17,51 @@ limitations under the License.
 package v1
 
 import (
-	"github.com/golang/glog"
+	"context"
+
 	core "k8s.io/api/core/v1"
-	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/strategicpatch"
-	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
 	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/generic"
 )
 
-func CreateOrPatchEndpoints(c kubernetes.Interface, meta metav1.ObjectMeta, transform func(*core.Endpoints) *core.Endpoints) (*core.Endpoints, kutil.VerbType, error) {
-	cur, err := c.CoreV1().Endpoints(meta.Namespace).Get(meta.Name, metav1.GetOptions{})
-	if kerr.IsNotFound(err) {
-		glog.V(3).Infof("Creating Endpoints %s/%s.", meta.Namespace, meta.Name)
-		out, err := c.CoreV1().Endpoints(meta.Namespace).Create(transform(&core.Endpoints{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Endpoints",
-				APIVersion: core.SchemeGroupVersion.String(),
-			},
-			ObjectMeta: meta,
-		}))
-		return out, kutil.VerbCreated, err
-	} else if err != nil {
-		return nil, kutil.VerbUnchanged, err
-	}
-	return PatchEndpoints(c, cur, transform)
+// CreateOrPatchEndpoints creates the Endpoints if it doesn't exist, or patches
+// it otherwise. Pass a kutil.PatchOptions to opt into Server-Side Apply or a
+// plain JSON merge patch instead of the default two-way strategic merge. It's
+// a thin wrapper around generic.CreateOrPatch -- see that package for how
+// each mode actually talks to the API server.
+func CreateOrPatchEndpoints(ctx context.Context, c client.Client, meta metav1.ObjectMeta, transform func(*core.Endpoints) *core.Endpoints, opts ...kutil.PatchOptions) (*core.Endpoints, kutil.VerbType, error) {
+	key := types.NamespacedName{Namespace: meta.Namespace, Name: meta.Name}
+	return generic.CreateOrPatch(ctx, c, key, func(obj *core.Endpoints) error {
+		obj.TypeMeta = metav1.TypeMeta{Kind: "Endpoints", APIVersion: core.SchemeGroupVersion.String()}
+		*obj = *transform(obj)
+		return nil
+	}, opts...)
 }
 
-func PatchEndpoints(c kubernetes.Interface, cur *core.Endpoints, transform func(*core.Endpoints) *core.Endpoints) (*core.Endpoints, kutil.VerbType, error) {
-	return PatchEndpointsObject(c, cur, transform(cur.DeepCopy()))
+// ApplyEndpoints behaves like CreateOrPatchEndpoints, but always computes a
+// three-way strategic merge patch from the LastAppliedConfigAnnotation, just
+// like `kubectl apply`. Unlike the default two-way patch, it correctly
+// removes fields the caller stopped setting.
+func ApplyEndpoints(ctx context.Context, c client.Client, meta metav1.ObjectMeta, transform func(*core.Endpoints) *core.Endpoints) (*core.Endpoints, kutil.VerbType, error) {
+	return CreateOrPatchEndpoints(ctx, c, meta, transform, kutil.PatchOptions{Mode: kutil.ThreeWayMergePatch})
 }
 
-func PatchEndpointsObject(c kubernetes.Interface, cur, mod *core.Endpoints) (*core.Endpoints, kutil.VerbType, error) {
-	curJson, err := json.Marshal(cur)
-	if err != nil {
-		return nil, kutil.VerbUnchanged, err
-	}
-
-	modJson, err := json.Marshal(mod)
-	if err != nil {
-		return nil, kutil.VerbUnchanged, err
-	}
+// PatchEndpoints patches cur with the result of transform. See
+// CreateOrPatchEndpoints for the meaning of opts.
+func PatchEndpoints(ctx context.Context, c client.Client, cur *core.Endpoints, transform func(*core.Endpoints) *core.Endpoints, opts ...kutil.PatchOptions) (*core.Endpoints, kutil.VerbType, error) {
+	return PatchEndpointsObject(ctx, c, cur, transform(cur.DeepCopy()), opts...)
+}
 
-	patch, err := strategicpatch.CreateTwoWayMergePatch(curJson, modJson, core.Endpoints{})
-	if err != nil {
-		return nil, kutil.VerbUnchanged, err
-	}
-	if len(patch) == 0 || string(patch) == "{}" {
-		return cur, kutil.VerbUnchanged, nil
-	}
-	glog.V(3).Infof("Patching Endpoints %s/%s with %s.", cur.Namespace, cur.Name, string(patch))
-	out, err := c.CoreV1().Endpoints(cur.Namespace).Patch(cur.Name, types.StrategicMergePatchType, patch)
-	return out, kutil.VerbPatched, err
+// PatchEndpointsObject patches cur into mod. See CreateOrPatchEndpoints for
+// the meaning of opts.
+func PatchEndpointsObject(ctx context.Context, c client.Client, cur, mod *core.Endpoints, opts ...kutil.PatchOptions) (*core.Endpoints, kutil.VerbType, error) {
+	key := types.NamespacedName{Namespace: cur.Namespace, Name: cur.Name}
+	return generic.CreateOrPatch(ctx, c, key, func(obj *core.Endpoints) error {
+		*obj = *mod
+		return nil
+	}, opts...)
 }
@@ -0,0 +1,204 @@
+/*
+Copyright The Kmodules Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	kutil "kmodules.xyz/client-go"
+)
+
+func newTestEndpoints(name string, labels map[string]string, lastApplied string) *core.Endpoints {
+	annotations := map[string]string{}
+	if lastApplied != "" {
+		annotations[kutil.LastAppliedConfigAnnotation] = lastApplied
+	}
+	return &core.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return data
+}
+
+func bytesContain(haystack []byte, needle string) bool {
+	return strings.Contains(string(haystack), needle)
+}
+
+// TestPatchEndpointsObjectServerSideApplyPropagatesConflict verifies that a
+// field-ownership conflict reported by the API server surfaces to the caller
+// as a recognizable apierrors.IsConflict error, rather than being swallowed.
+func TestPatchEndpointsObjectServerSideApplyPropagatesConflict(t *testing.T) {
+	cur := newTestEndpoints("web", map[string]string{"owner": "team-a"}, "")
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cur).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, cli client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return cli.Patch(ctx, obj, patch, opts...)
+			}
+			return apierrors.NewConflict(schema.GroupResource{Resource: "endpoints"}, cur.Name, fmt.Errorf("field \"owner\" is owned by team-a"))
+		},
+	}).Build()
+
+	mod := cur.DeepCopy()
+	mod.Labels["owner"] = "team-b"
+
+	_, verb, err := PatchEndpointsObject(context.Background(), c, cur, mod, kutil.PatchOptions{Mode: kutil.ServerSideApply, FieldManager: "team-b"})
+	if err == nil {
+		t.Fatal("expected a conflict error, got nil")
+	}
+	if !apierrors.IsConflict(err) {
+		t.Fatalf("expected apierrors.IsConflict(err) to be true, got %v", err)
+	}
+	if verb != kutil.VerbUnchanged {
+		t.Fatalf("expected VerbUnchanged on error, got %v", verb)
+	}
+}
+
+// TestPatchEndpointsObjectServerSideApplySendsModVerbatim verifies that an
+// omitted field is released under Server-Side Apply: the object sent as the
+// apply patch is exactly mod, so a label present on cur but dropped from mod
+// is absent from what's sent to the API server.
+func TestPatchEndpointsObjectServerSideApplySendsModVerbatim(t *testing.T) {
+	cur := newTestEndpoints("web", map[string]string{"owner": "team-a", "tier": "backend"}, "")
+
+	var applied *core.Endpoints
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cur).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, cli client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return cli.Patch(ctx, obj, patch, opts...)
+			}
+			applied = obj.(*core.Endpoints).DeepCopy()
+			return nil
+		},
+	}).Build()
+
+	mod := cur.DeepCopy()
+	delete(mod.Labels, "owner")
+
+	_, verb, err := PatchEndpointsObject(context.Background(), c, cur, mod, kutil.PatchOptions{Mode: kutil.ServerSideApply, FieldManager: "team-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verb != kutil.VerbPatched {
+		t.Fatalf("expected VerbPatched, got %v", verb)
+	}
+	if applied == nil {
+		t.Fatal("expected the apply patch to be sent")
+	}
+	if _, ok := applied.Labels["owner"]; ok {
+		t.Fatalf("expected omitted field %q to be released, got labels: %v", "owner", applied.Labels)
+	}
+	if applied.Labels["tier"] != "backend" {
+		t.Fatalf("expected retained field %q in the apply patch, got labels: %v", "tier", applied.Labels)
+	}
+}
+
+// TestPatchEndpointsObjectThreeWayMergeKeepsFieldsItDoesNotOwn demonstrates
+// the field-removal gap a plain two-way strategic merge patch has: a label
+// added out-of-band (present on cur but absent from both the recorded
+// original and mod) is preserved by ThreeWayMergePatch, since the three-way
+// diff only removes fields the recorded original has and mod no longer sets.
+func TestPatchEndpointsObjectThreeWayMergeKeepsFieldsItDoesNotOwn(t *testing.T) {
+	original := newTestEndpoints("web", map[string]string{"tier": "backend"}, "")
+	originalJSON := mustMarshal(t, original)
+
+	cur := newTestEndpoints("web", map[string]string{"tier": "backend", "injected-by": "another-controller"}, string(originalJSON))
+	mod := newTestEndpoints("web", map[string]string{"tier": "backend"}, "")
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cur).Build()
+	_, verb, err := PatchEndpointsObject(context.Background(), c, cur, mod, kutil.PatchOptions{Mode: kutil.ThreeWayMergePatch})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verb != kutil.VerbPatched {
+		t.Fatalf("expected VerbPatched, got %v", verb)
+	}
+
+	var out core.Endpoints
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(cur), &out); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if out.Labels["injected-by"] != "another-controller" {
+		t.Fatalf("expected out-of-band label to survive a three-way merge, got labels: %v", out.Labels)
+	}
+
+	// By contrast, a plain two-way strategic merge patch computed straight
+	// from cur and mod (the StrategicMerge/MergePatch code path) would strip
+	// it, since it only sees cur and mod and has no original to consult.
+	curJSON := mustMarshal(t, cur)
+	modJSON := mustMarshal(t, mod)
+	twoWay, err := strategicpatch.CreateTwoWayMergePatch(curJSON, modJSON, core.Endpoints{})
+	if err != nil {
+		t.Fatalf("two-way patch: %v", err)
+	}
+	if !bytesContain(twoWay, `"injected-by":null`) {
+		t.Fatalf("expected the two-way patch to null out the unowned field, got: %s", twoWay)
+	}
+}
+
+// TestPatchEndpointsObjectThreeWayMergeRemovesFieldCallerStoppedSetting
+// demonstrates the behavior ThreeWayMergePatch exists for: a field the
+// original and cur agree on, but mod no longer sets, is removed -- something
+// that must be read off the recorded original, since mod here is built
+// independently of cur.
+func TestPatchEndpointsObjectThreeWayMergeRemovesFieldCallerStoppedSetting(t *testing.T) {
+	original := newTestEndpoints("web", map[string]string{"tier": "backend", "owner": "team-a"}, "")
+	originalJSON := mustMarshal(t, original)
+
+	cur := newTestEndpoints("web", map[string]string{"tier": "backend", "owner": "team-a"}, string(originalJSON))
+	mod := newTestEndpoints("web", map[string]string{"tier": "backend"}, "")
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cur).Build()
+	_, _, err := PatchEndpointsObject(context.Background(), c, cur, mod, kutil.PatchOptions{Mode: kutil.ThreeWayMergePatch})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var out core.Endpoints
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(cur), &out); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if _, ok := out.Labels["owner"]; ok {
+		t.Fatalf("expected label the caller stopped setting to be removed, got labels: %v", out.Labels)
+	}
+}
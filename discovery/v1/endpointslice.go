@@ -0,0 +1,259 @@
+/*
+Copyright The Kmodules Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/golang/glog"
+	core "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/generic"
+)
+
+// ServiceNameLabel is the label EndpointSlices carry to point back at their
+// owning Service. It mirrors the label the endpointslice controller sets on
+// every slice it creates.
+const ServiceNameLabel = "kubernetes.io/service-name"
+
+// MaxAddressesPerSlice caps the number of endpoints SyncEndpointsToSlices
+// writes into a single EndpointSlice, matching the default the upstream
+// endpointslice controller uses.
+const MaxAddressesPerSlice = 100
+
+// CreateOrPatchEndpointSlice creates the EndpointSlice if it doesn't exist, or
+// patches it otherwise. Pass a kutil.PatchOptions to opt into Server-Side
+// Apply or a plain JSON merge patch instead of the default two-way strategic
+// merge. It's a thin wrapper around generic.CreateOrPatch -- see that package
+// for how each mode actually talks to the API server.
+func CreateOrPatchEndpointSlice(ctx context.Context, c client.Client, meta metav1.ObjectMeta, transform func(*discovery.EndpointSlice) *discovery.EndpointSlice, opts ...kutil.PatchOptions) (*discovery.EndpointSlice, kutil.VerbType, error) {
+	key := types.NamespacedName{Namespace: meta.Namespace, Name: meta.Name}
+	return generic.CreateOrPatch(ctx, c, key, func(obj *discovery.EndpointSlice) error {
+		obj.TypeMeta = metav1.TypeMeta{Kind: "EndpointSlice", APIVersion: discovery.SchemeGroupVersion.String()}
+		*obj = *transform(obj)
+		return nil
+	}, opts...)
+}
+
+// ApplyEndpointSlice behaves like CreateOrPatchEndpointSlice, but always
+// computes a three-way strategic merge patch from the
+// LastAppliedConfigAnnotation, just like `kubectl apply`. Unlike the default
+// two-way patch, it correctly removes fields the caller stopped setting.
+func ApplyEndpointSlice(ctx context.Context, c client.Client, meta metav1.ObjectMeta, transform func(*discovery.EndpointSlice) *discovery.EndpointSlice) (*discovery.EndpointSlice, kutil.VerbType, error) {
+	return CreateOrPatchEndpointSlice(ctx, c, meta, transform, kutil.PatchOptions{Mode: kutil.ThreeWayMergePatch})
+}
+
+// PatchEndpointSlice patches cur with the result of transform. See
+// CreateOrPatchEndpointSlice for the meaning of opts.
+func PatchEndpointSlice(ctx context.Context, c client.Client, cur *discovery.EndpointSlice, transform func(*discovery.EndpointSlice) *discovery.EndpointSlice, opts ...kutil.PatchOptions) (*discovery.EndpointSlice, kutil.VerbType, error) {
+	return PatchEndpointSliceObject(ctx, c, cur, transform(cur.DeepCopy()), opts...)
+}
+
+// PatchEndpointSliceObject patches cur into mod. See CreateOrPatchEndpointSlice
+// for the meaning of opts.
+func PatchEndpointSliceObject(ctx context.Context, c client.Client, cur, mod *discovery.EndpointSlice, opts ...kutil.PatchOptions) (*discovery.EndpointSlice, kutil.VerbType, error) {
+	key := types.NamespacedName{Namespace: cur.Namespace, Name: cur.Name}
+	return generic.CreateOrPatch(ctx, c, key, func(obj *discovery.EndpointSlice) error {
+		*obj = *mod
+		return nil
+	}, opts...)
+}
+
+// ListEndpointSlicesFor returns the EndpointSlices owned by svc, matched via
+// the ServiceNameLabel the endpointslice controller sets on every slice it
+// creates for a Service.
+func ListEndpointSlicesFor(ctx context.Context, c client.Client, svc *core.Service) ([]discovery.EndpointSlice, error) {
+	sel := labels.Set{ServiceNameLabel: svc.Name}.AsSelector()
+	var list discovery.EndpointSliceList
+	if err := c.List(ctx, &list, client.InNamespace(svc.Namespace), client.MatchingLabelsSelector{Selector: sel}); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// SyncEndpointsToSlices converts eps into the equivalent set of
+// discovery.k8s.io/v1 EndpointSlices, splitting addresses by IP family and by
+// MaxAddressesPerSlice. It's a compatibility shim for operators that still
+// build a core/v1 Endpoints object and want to start writing (or dual-writing)
+// EndpointSlices without rewriting their reconcile logic.
+//
+// Each returned slice has a deterministic Name, derived from eps's own name
+// and its position in the bucketed output, so that calling this repeatedly
+// for the same eps and passing each result through CreateOrPatchEndpointSlice
+// patches the same slices instead of creating new ones every time. Callers
+// that need stale slices (eg. from a shrinking Endpoints) cleaned up too
+// should use SyncEndpointSlicesFor instead of calling this directly.
+func SyncEndpointsToSlices(eps *core.Endpoints) ([]*discovery.EndpointSlice, error) {
+	type bucket struct {
+		addrType discovery.AddressType
+		ports    []discovery.EndpointPort
+		eps      []discovery.Endpoint
+	}
+	buckets := map[string]*bucket{}
+	var order []string
+
+	bucketFor := func(addrType discovery.AddressType, ports []discovery.EndpointPort) *bucket {
+		key := fmt.Sprintf("%s|%s", addrType, portSignature(ports))
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{addrType: addrType, ports: ports}
+			buckets[key] = b
+			order = append(order, key)
+		}
+		return b
+	}
+
+	for _, subset := range eps.Subsets {
+		ports := make([]discovery.EndpointPort, 0, len(subset.Ports))
+		for _, p := range subset.Ports {
+			name, proto, port := p.Name, p.Protocol, p.Port
+			ports = append(ports, discovery.EndpointPort{Name: &name, Protocol: &proto, Port: &port})
+		}
+
+		addAddresses := func(addrs []core.EndpointAddress, ready bool) {
+			for _, a := range addrs {
+				addrType := discovery.AddressTypeIPv4
+				if ip := net.ParseIP(a.IP); ip != nil && ip.To4() == nil {
+					addrType = discovery.AddressTypeIPv6
+				}
+
+				var hostname *string
+				if a.Hostname != "" {
+					h := a.Hostname
+					hostname = &h
+				}
+				readyCopy := ready
+
+				b := bucketFor(addrType, ports)
+				b.eps = append(b.eps, discovery.Endpoint{
+					Addresses:  []string{a.IP},
+					Conditions: discovery.EndpointConditions{Ready: &readyCopy},
+					Hostname:   hostname,
+					TargetRef:  a.TargetRef,
+					NodeName:   a.NodeName,
+				})
+			}
+		}
+		addAddresses(subset.Addresses, true)
+		addAddresses(subset.NotReadyAddresses, false)
+	}
+
+	var out []*discovery.EndpointSlice
+	sliceIdx := 0
+	for _, key := range order {
+		b := buckets[key]
+		for i := 0; i < len(b.eps); i += MaxAddressesPerSlice {
+			end := i + MaxAddressesPerSlice
+			if end > len(b.eps) {
+				end = len(b.eps)
+			}
+			out = append(out, &discovery.EndpointSlice{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "EndpointSlice",
+					APIVersion: discovery.SchemeGroupVersion.String(),
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s-%d", eps.Name, sliceIdx),
+					Namespace: eps.Namespace,
+					Labels:    map[string]string{ServiceNameLabel: eps.Name},
+				},
+				AddressType: b.addrType,
+				Ports:       b.ports,
+				Endpoints:   append([]discovery.Endpoint(nil), b.eps[i:end]...),
+			})
+			sliceIdx++
+		}
+	}
+	return out, nil
+}
+
+// SyncEndpointSlicesFor computes the desired EndpointSlices for eps via
+// SyncEndpointsToSlices, creates or patches each one, and deletes any
+// existing EndpointSlice for the same Service (per ListEndpointSlicesFor)
+// that isn't in the desired set -- eg. because eps shrank by a full slice's
+// worth of addresses since the last sync. Calling SyncEndpointsToSlices and
+// CreateOrPatchEndpointSlice directly does the create/patch half of this but
+// never removes slices that are no longer needed.
+func SyncEndpointSlicesFor(ctx context.Context, c client.Client, eps *core.Endpoints, opts ...kutil.PatchOptions) ([]*discovery.EndpointSlice, error) {
+	desired, err := SyncEndpointsToSlices(eps)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	out := make([]*discovery.EndpointSlice, 0, len(desired))
+	for _, slice := range desired {
+		wanted[slice.Name] = true
+		cur, _, err := CreateOrPatchEndpointSlice(ctx, c, slice.ObjectMeta, func(in *discovery.EndpointSlice) *discovery.EndpointSlice {
+			in.Labels = slice.Labels
+			in.AddressType = slice.AddressType
+			in.Ports = slice.Ports
+			in.Endpoints = slice.Endpoints
+			return in
+		}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, cur)
+	}
+
+	existing, err := ListEndpointSlicesFor(ctx, c, &core.Service{ObjectMeta: metav1.ObjectMeta{Namespace: eps.Namespace, Name: eps.Name}})
+	if err != nil {
+		return nil, err
+	}
+	for i := range existing {
+		slice := &existing[i]
+		if wanted[slice.Name] {
+			continue
+		}
+		glog.V(3).Infof("Deleting stale EndpointSlice %s/%s.", slice.Namespace, slice.Name)
+		if err := c.Delete(ctx, slice); err != nil && !kerr.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func portSignature(ports []discovery.EndpointPort) string {
+	parts := make([]string, 0, len(ports))
+	for _, p := range ports {
+		name := ""
+		if p.Name != nil {
+			name = *p.Name
+		}
+		proto := core.ProtocolTCP
+		if p.Protocol != nil {
+			proto = *p.Protocol
+		}
+		port := int32(0)
+		if p.Port != nil {
+			port = *p.Port
+		}
+		parts = append(parts, fmt.Sprintf("%s/%s/%d", name, proto, port))
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,268 @@
+/*
+Copyright The Kmodules Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	discovery "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	kutil "kmodules.xyz/client-go"
+)
+
+func newTestEndpointSlice(name string, labels map[string]string, lastApplied string) *discovery.EndpointSlice {
+	annotations := map[string]string{}
+	if lastApplied != "" {
+		annotations[kutil.LastAppliedConfigAnnotation] = lastApplied
+	}
+	return &discovery.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		AddressType: discovery.AddressTypeIPv4,
+	}
+}
+
+// TestPatchEndpointSliceObjectServerSideApplyPropagatesConflict mirrors
+// core/v1's equivalent test: a field-ownership conflict from the API server
+// surfaces as apierrors.IsConflict rather than being swallowed.
+func TestPatchEndpointSliceObjectServerSideApplyPropagatesConflict(t *testing.T) {
+	cur := newTestEndpointSlice("web-0", map[string]string{ServiceNameLabel: "web"}, "")
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cur).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, cli client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return cli.Patch(ctx, obj, patch, opts...)
+			}
+			return apierrors.NewConflict(schema.GroupResource{Resource: "endpointslices"}, cur.Name, fmt.Errorf("field \"endpoints\" is owned by another-controller"))
+		},
+	}).Build()
+
+	mod := cur.DeepCopy()
+	mod.Endpoints = []discovery.Endpoint{{Addresses: []string{"10.0.0.1"}}}
+
+	_, verb, err := PatchEndpointSliceObject(context.Background(), c, cur, mod, kutil.PatchOptions{Mode: kutil.ServerSideApply, FieldManager: "team-b"})
+	if err == nil {
+		t.Fatal("expected a conflict error, got nil")
+	}
+	if !apierrors.IsConflict(err) {
+		t.Fatalf("expected apierrors.IsConflict(err) to be true, got %v", err)
+	}
+	if verb != kutil.VerbUnchanged {
+		t.Fatalf("expected VerbUnchanged on error, got %v", verb)
+	}
+}
+
+// TestPatchEndpointSliceObjectServerSideApplySendsModVerbatim mirrors
+// core/v1's equivalent test: a field omitted from mod is released, since the
+// object sent as the apply patch is exactly mod.
+func TestPatchEndpointSliceObjectServerSideApplySendsModVerbatim(t *testing.T) {
+	cur := newTestEndpointSlice("web-0", map[string]string{ServiceNameLabel: "web", "owner": "team-a"}, "")
+
+	var applied *discovery.EndpointSlice
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cur).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, cli client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if patch.Type() != types.ApplyPatchType {
+				return cli.Patch(ctx, obj, patch, opts...)
+			}
+			applied = obj.(*discovery.EndpointSlice).DeepCopy()
+			return nil
+		},
+	}).Build()
+
+	mod := cur.DeepCopy()
+	delete(mod.Labels, "owner")
+
+	_, verb, err := PatchEndpointSliceObject(context.Background(), c, cur, mod, kutil.PatchOptions{Mode: kutil.ServerSideApply, FieldManager: "team-a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verb != kutil.VerbPatched {
+		t.Fatalf("expected VerbPatched, got %v", verb)
+	}
+	if applied == nil {
+		t.Fatal("expected the apply patch to be sent")
+	}
+	if _, ok := applied.Labels["owner"]; ok {
+		t.Fatalf("expected omitted field %q to be released, got labels: %v", "owner", applied.Labels)
+	}
+	if applied.Labels[ServiceNameLabel] != "web" {
+		t.Fatalf("expected retained field %q in the apply patch, got labels: %v", ServiceNameLabel, applied.Labels)
+	}
+}
+
+// TestSyncEndpointsToSlicesBucketsByAddressFamilyAndSplitsByMaxAddresses
+// exercises the nontrivial bucketing/splitting logic: addresses split by IP
+// family into separate slices, and a bucket larger than MaxAddressesPerSlice
+// split across multiple slices.
+func TestSyncEndpointsToSlicesBucketsByAddressFamilyAndSplitsByMaxAddresses(t *testing.T) {
+	eps := &core.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+	}
+	port := int32(80)
+	for i := 0; i < MaxAddressesPerSlice+1; i++ {
+		eps.Subsets = append(eps.Subsets, core.EndpointSubset{
+			Addresses: []core.EndpointAddress{{IP: fmt.Sprintf("10.0.0.%d", i%250+1)}},
+			Ports:     []core.EndpointPort{{Port: port}},
+		})
+	}
+	eps.Subsets = append(eps.Subsets, core.EndpointSubset{
+		Addresses: []core.EndpointAddress{{IP: "2001:db8::1"}},
+		Ports:     []core.EndpointPort{{Port: port}},
+	})
+
+	slices, err := SyncEndpointsToSlices(eps)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var v4Count, v6Count int
+	for _, s := range slices {
+		switch s.AddressType {
+		case discovery.AddressTypeIPv4:
+			v4Count += len(s.Endpoints)
+		case discovery.AddressTypeIPv6:
+			v6Count += len(s.Endpoints)
+		}
+		if len(s.Endpoints) > MaxAddressesPerSlice {
+			t.Fatalf("expected no slice to exceed MaxAddressesPerSlice endpoints, got %d", len(s.Endpoints))
+		}
+	}
+	if v4Count != MaxAddressesPerSlice+1 {
+		t.Fatalf("expected %d IPv4 endpoints total, got %d", MaxAddressesPerSlice+1, v4Count)
+	}
+	if v6Count != 1 {
+		t.Fatalf("expected 1 IPv6 endpoint total, got %d", v6Count)
+	}
+
+	// The IPv4 bucket alone must have spilled into a second slice.
+	var v4Slices int
+	for _, s := range slices {
+		if s.AddressType == discovery.AddressTypeIPv4 {
+			v4Slices++
+		}
+	}
+	if v4Slices < 2 {
+		t.Fatalf("expected the oversized IPv4 bucket to split across at least 2 slices, got %d", v4Slices)
+	}
+}
+
+// TestSyncEndpointSlicesForCreatesOnceAndPatchesAfter is the end-to-end
+// regression test for the SyncEndpointsToSlices -> CreateOrPatchEndpointSlice
+// round trip: SyncEndpointsToSlices used to hand back GenerateName-only
+// ObjectMeta, which CreateOrPatchEndpointSlice's Get-by-Name rejected outright
+// (client-go/client.Get on an empty name errors before ever reaching the
+// server), so the documented round trip never created anything. Syncing the
+// same Endpoints twice must create exactly one EndpointSlice, then patch it.
+func TestSyncEndpointSlicesForCreatesOnceAndPatchesAfter(t *testing.T) {
+	eps := &core.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Subsets: []core.EndpointSubset{{
+			Addresses: []core.EndpointAddress{{IP: "10.0.0.1"}},
+			Ports:     []core.EndpointPort{{Port: 80}},
+		}},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+
+	first, err := SyncEndpointSlicesFor(context.Background(), c, eps)
+	if err != nil {
+		t.Fatalf("unexpected error on first sync: %v", err)
+	}
+	if len(first) != 1 {
+		t.Fatalf("expected exactly 1 EndpointSlice, got %d", len(first))
+	}
+
+	var listed discovery.EndpointSliceList
+	if err := c.List(context.Background(), &listed, client.InNamespace(eps.Namespace)); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(listed.Items) != 1 {
+		t.Fatalf("expected exactly 1 EndpointSlice to exist after the first sync, got %d", len(listed.Items))
+	}
+
+	eps.Subsets[0].Addresses[0].IP = "10.0.0.2"
+	second, err := SyncEndpointSlicesFor(context.Background(), c, eps)
+	if err != nil {
+		t.Fatalf("unexpected error on second sync: %v", err)
+	}
+	if len(second) != 1 {
+		t.Fatalf("expected exactly 1 EndpointSlice after the second sync, got %d", len(second))
+	}
+	if second[0].Name != first[0].Name {
+		t.Fatalf("expected the second sync to patch the same slice %q, got a different name %q", first[0].Name, second[0].Name)
+	}
+
+	if err := c.List(context.Background(), &listed, client.InNamespace(eps.Namespace)); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(listed.Items) != 1 {
+		t.Fatalf("expected repeated syncs to reuse the same slice rather than pile up new ones, got %d slices", len(listed.Items))
+	}
+}
+
+// TestSyncEndpointSlicesForDeletesStaleSlices verifies the other half of the
+// fix: when eps shrinks enough to need fewer slices, SyncEndpointSlicesFor
+// removes the ones that are no longer wanted instead of leaving them behind.
+func TestSyncEndpointSlicesForDeletesStaleSlices(t *testing.T) {
+	eps := &core.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+	}
+	for i := 0; i < MaxAddressesPerSlice+1; i++ {
+		eps.Subsets = append(eps.Subsets, core.EndpointSubset{
+			Addresses: []core.EndpointAddress{{IP: fmt.Sprintf("10.0.%d.%d", i/250, i%250+1)}},
+			Ports:     []core.EndpointPort{{Port: 80}},
+		})
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	if _, err := SyncEndpointSlicesFor(context.Background(), c, eps); err != nil {
+		t.Fatalf("unexpected error on first sync: %v", err)
+	}
+
+	var listed discovery.EndpointSliceList
+	if err := c.List(context.Background(), &listed, client.InNamespace(eps.Namespace)); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(listed.Items) != 2 {
+		t.Fatalf("expected 2 EndpointSlices after the first sync, got %d", len(listed.Items))
+	}
+
+	eps.Subsets = eps.Subsets[:1]
+	if _, err := SyncEndpointSlicesFor(context.Background(), c, eps); err != nil {
+		t.Fatalf("unexpected error on second sync: %v", err)
+	}
+
+	if err := c.List(context.Background(), &listed, client.InNamespace(eps.Namespace)); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(listed.Items) != 1 {
+		t.Fatalf("expected the now-unneeded second slice to be deleted, got %d slices", len(listed.Items))
+	}
+}
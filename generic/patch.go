@@ -0,0 +1,242 @@
+/*
+Copyright The Kmodules Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package generic provides a single CreateOrPatch helper, built on
+// sigs.k8s.io/controller-runtime/pkg/client and Go generics, for any
+// client.Object -- including CRDs this module doesn't (and can't) enumerate.
+//
+// The per-kind CreateOrPatch* helpers elsewhere in this module (eg.
+// core/v1.CreateOrPatchEndpoints) are thin wrappers around CreateOrPatch:
+// they exist only to give callers a concretely-typed transform function
+// instead of having to spell out the type parameter and
+// types.NamespacedName themselves. The three-way-merge and Server-Side
+// Apply machinery lives here, once, behind client.Object.
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kutil "kmodules.xyz/client-go"
+)
+
+// CreateOrPatch fetches the T named key, applies mutate to a deep copy of
+// whatever it finds (or to a freshly named zero value if it doesn't exist
+// yet), and either creates the result or patches the difference back to the
+// API server. Pass a kutil.PatchOptions to opt into Server-Side Apply or a
+// three-way/plain JSON merge patch instead of the default two-way strategic
+// merge patch.
+//
+// The two-way patch is computed as a strategic merge patch when T carries
+// the patch-strategy struct tag metadata strategicpatch needs (true for
+// every built-in type and most generated CRD structs), and falls back to a
+// plain JSON merge patch otherwise (eg. when T is unstructured.Unstructured).
+func CreateOrPatch[T client.Object](ctx context.Context, c client.Client, key types.NamespacedName, mutate func(obj T) error, opts ...kutil.PatchOptions) (T, kutil.VerbType, error) {
+	o := kutil.MergePatchOptions(opts...)
+
+	if o.Mode == kutil.ServerSideApply {
+		return applyObject(ctx, c, key, mutate, o)
+	}
+
+	cur := newOf[T]()
+	err := c.Get(ctx, key, cur)
+	if apierrors.IsNotFound(err) {
+		obj := newOf[T]()
+		obj.SetNamespace(key.Namespace)
+		obj.SetName(key.Name)
+		if err := mutate(obj); err != nil {
+			var zero T
+			return zero, kutil.VerbUnchanged, err
+		}
+		if o.Mode == kutil.ThreeWayMergePatch {
+			if _, err := StampLastAppliedConfig(obj); err != nil {
+				var zero T
+				return zero, kutil.VerbUnchanged, err
+			}
+		}
+		if err := c.Create(ctx, obj); err != nil {
+			var zero T
+			return zero, kutil.VerbUnchanged, err
+		}
+		return obj, kutil.VerbCreated, nil
+	} else if err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+
+	mod := cur.DeepCopyObject().(T)
+	if err := mutate(mod); err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+
+	if o.Mode == kutil.ThreeWayMergePatch {
+		return threeWayPatch(ctx, c, cur, mod)
+	}
+	return patch(ctx, c, cur, mod, o)
+}
+
+// applyObject builds a fresh T from mutate and sends it as a Server-Side
+// Apply patch under o.FieldManager (and o.Force), creating T if it doesn't
+// exist yet. Unlike the other modes, this skips the initial Get: the API
+// server computes the merge against the field manager's last applied
+// intent, not against a client-observed copy.
+func applyObject[T client.Object](ctx context.Context, c client.Client, key types.NamespacedName, mutate func(obj T) error, o kutil.PatchOptions) (T, kutil.VerbType, error) {
+	obj := newOf[T]()
+	obj.SetNamespace(key.Namespace)
+	obj.SetName(key.Name)
+	if err := mutate(obj); err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+
+	patchOpts := []client.PatchOption{client.FieldOwner(o.FieldManager)}
+	if o.Force {
+		patchOpts = append(patchOpts, client.ForceOwnership)
+	}
+	if err := c.Patch(ctx, obj, client.Apply, patchOpts...); err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+	return obj, kutil.VerbPatched, nil
+}
+
+// newOf returns a new, empty T. Every client.Object implementation is a
+// pointer to a struct, so a plain `var obj T` would just be a typed nil;
+// newOf allocates the pointed-to struct instead.
+func newOf[T client.Object]() T {
+	var obj T
+	elem := reflect.TypeOf(obj).Elem()
+	return reflect.New(elem).Interface().(T)
+}
+
+// patch computes and sends a two-way patch from cur to mod: a strategic
+// merge patch, falling back to a plain JSON merge patch if T doesn't carry
+// strategic merge patch metadata, or a plain JSON merge patch directly when
+// o.Mode is kutil.MergePatch.
+func patch[T client.Object](ctx context.Context, c client.Client, cur, mod T, o kutil.PatchOptions) (T, kutil.VerbType, error) {
+	curJson, err := json.Marshal(cur)
+	if err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+	modJson, err := json.Marshal(mod)
+	if err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+
+	pt := types.StrategicMergePatchType
+	var patchBytes []byte
+	if o.Mode == kutil.MergePatch {
+		pt = types.MergePatchType
+		patchBytes, err = jsonpatch.CreateMergePatch(curJson, modJson)
+	} else {
+		patchBytes, err = strategicpatch.CreateTwoWayMergePatch(curJson, modJson, cur)
+		if err != nil {
+			pt = types.MergePatchType
+			patchBytes, err = jsonpatch.CreateMergePatch(curJson, modJson)
+		}
+	}
+	if err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+	if len(patchBytes) == 0 || string(patchBytes) == "{}" {
+		return cur, kutil.VerbUnchanged, nil
+	}
+
+	out := cur.DeepCopyObject().(T)
+	if err := c.Patch(ctx, out, client.RawPatch(pt, patchBytes)); err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+	return out, kutil.VerbPatched, nil
+}
+
+// threeWayPatch patches cur into mod using the original object recorded in
+// cur's kutil.LastAppliedConfigAnnotation, mod, and cur itself, exactly like
+// `kubectl apply`. See ThreeWayMergePatch for how the patch is computed.
+func threeWayPatch[T client.Object](ctx context.Context, c client.Client, cur, mod T) (T, kutil.VerbType, error) {
+	patchBytes, err := ThreeWayMergePatch(cur, mod)
+	if err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+	if len(patchBytes) == 0 || string(patchBytes) == "{}" {
+		return cur, kutil.VerbUnchanged, nil
+	}
+
+	out := cur.DeepCopyObject().(T)
+	if err := c.Patch(ctx, out, client.RawPatch(types.StrategicMergePatchType, patchBytes)); err != nil {
+		var zero T
+		return zero, kutil.VerbUnchanged, err
+	}
+	return out, kutil.VerbPatched, nil
+}
+
+// StampLastAppliedConfig records obj's own JSON, as it looked right before
+// the annotation was added, into obj's kutil.LastAppliedConfigAnnotation,
+// and returns obj's JSON with that annotation included.
+func StampLastAppliedConfig[T client.Object](obj T) ([]byte, error) {
+	ann := obj.GetAnnotations()
+	delete(ann, kutil.LastAppliedConfigAnnotation)
+	obj.SetAnnotations(ann)
+
+	withoutAnnotation, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if ann == nil {
+		ann = map[string]string{}
+	}
+	ann[kutil.LastAppliedConfigAnnotation] = string(withoutAnnotation)
+	obj.SetAnnotations(ann)
+
+	return json.Marshal(obj)
+}
+
+// ThreeWayMergePatch computes a three-way strategic merge patch from the
+// original object recorded in cur's kutil.LastAppliedConfigAnnotation, mod,
+// and cur, exactly like `kubectl apply`. mod's JSON is stamped into its own
+// LastAppliedConfigAnnotation first, so the next call has an original to
+// diff against.
+func ThreeWayMergePatch[T client.Object](cur, mod T) ([]byte, error) {
+	modJson, err := StampLastAppliedConfig(mod)
+	if err != nil {
+		return nil, err
+	}
+
+	var originalJson []byte
+	if original, ok := cur.GetAnnotations()[kutil.LastAppliedConfigAnnotation]; ok {
+		originalJson = []byte(original)
+	}
+
+	curJson, err := json.Marshal(cur)
+	if err != nil {
+		return nil, err
+	}
+
+	return strategicpatch.CreateThreeWayMergePatch(originalJson, modJson, curJson, cur, true)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright The Kmodules Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package generic
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	kutil "kmodules.xyz/client-go"
+)
+
+func newTestConfigMap(name string, data map[string]string, lastApplied string) *core.ConfigMap {
+	annotations := map[string]string{}
+	if lastApplied != "" {
+		annotations[kutil.LastAppliedConfigAnnotation] = lastApplied
+	}
+	return &core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        name,
+			Annotations: annotations,
+		},
+		Data: data,
+	}
+}
+
+func TestNewOfAllocatesNonNilObject(t *testing.T) {
+	obj := newOf[*core.ConfigMap]()
+	if obj == nil {
+		t.Fatal("expected a non-nil *core.ConfigMap")
+	}
+	obj.Name = "probe"
+	if obj.Name != "probe" {
+		t.Fatal("expected to be able to write through the allocated pointer")
+	}
+}
+
+func TestStampLastAppliedConfigRoundTrips(t *testing.T) {
+	obj := newTestConfigMap("web", map[string]string{"k": "v"}, "")
+
+	stamped, err := StampLastAppliedConfig(obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ann := obj.GetAnnotations()[kutil.LastAppliedConfigAnnotation]
+	if ann == "" {
+		t.Fatal("expected LastAppliedConfigAnnotation to be set")
+	}
+
+	var recorded core.ConfigMap
+	if err := json.Unmarshal([]byte(ann), &recorded); err != nil {
+		t.Fatalf("unmarshal recorded annotation: %v", err)
+	}
+	if _, ok := recorded.Annotations[kutil.LastAppliedConfigAnnotation]; ok {
+		t.Fatal("expected the recorded original to not contain itself")
+	}
+	if recorded.Data["k"] != "v" {
+		t.Fatalf("expected the recorded original to carry obj's data, got %v", recorded.Data)
+	}
+
+	var out core.ConfigMap
+	if err := json.Unmarshal(stamped, &out); err != nil {
+		t.Fatalf("unmarshal stamped: %v", err)
+	}
+	if out.Annotations[kutil.LastAppliedConfigAnnotation] == "" {
+		t.Fatal("expected the returned JSON to include the annotation")
+	}
+}
+
+func TestThreeWayMergePatchKeepsFieldItDoesNotOwn(t *testing.T) {
+	original := newTestConfigMap("web", map[string]string{"k": "v"}, "")
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("marshal original: %v", err)
+	}
+
+	cur := newTestConfigMap("web", map[string]string{"k": "v", "injected-by": "another-controller"}, string(originalJSON))
+	mod := newTestConfigMap("web", map[string]string{"k": "v"}, "")
+
+	patchBytes, err := ThreeWayMergePatch[*core.ConfigMap](cur, mod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(patchBytes), `"injected-by"`) {
+		t.Fatalf("expected the unowned field to be left alone, got patch: %s", patchBytes)
+	}
+}
+
+func TestThreeWayMergePatchRemovesFieldCallerStoppedSetting(t *testing.T) {
+	original := newTestConfigMap("web", map[string]string{"k": "v", "owner": "team-a"}, "")
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("marshal original: %v", err)
+	}
+
+	cur := newTestConfigMap("web", map[string]string{"k": "v", "owner": "team-a"}, string(originalJSON))
+	mod := newTestConfigMap("web", map[string]string{"k": "v"}, "")
+
+	patchBytes, err := ThreeWayMergePatch[*core.ConfigMap](cur, mod)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(patchBytes), `"owner":null`) {
+		t.Fatalf("expected the patch to null out the dropped field, got: %s", patchBytes)
+	}
+}
+
+// TestCreateOrPatchMergePatchModeSendsPlainJSONMergePatch verifies the
+// kutil.MergePatch code path takes effect end-to-end: the patch sent is of
+// type types.MergePatchType, and a key the caller stopped setting is removed
+// by the plain JSON merge patch it computes.
+func TestCreateOrPatchMergePatchModeSendsPlainJSONMergePatch(t *testing.T) {
+	cur := newTestConfigMap("web", map[string]string{"k": "v", "drop-me": "x"}, "")
+	var sentType types.PatchType
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cur).WithInterceptorFuncs(interceptor.Funcs{
+		Patch: func(ctx context.Context, cli client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			sentType = patch.Type()
+			return cli.Patch(ctx, obj, patch, opts...)
+		},
+	}).Build()
+
+	_, verb, err := CreateOrPatch(context.Background(), c, client.ObjectKeyFromObject(cur), func(obj *core.ConfigMap) error {
+		delete(obj.Data, "drop-me")
+		return nil
+	}, kutil.PatchOptions{Mode: kutil.MergePatch})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verb != kutil.VerbPatched {
+		t.Fatalf("expected VerbPatched, got %v", verb)
+	}
+	if sentType != types.MergePatchType {
+		t.Fatalf("expected a %q patch, got %q", types.MergePatchType, sentType)
+	}
+
+	var out core.ConfigMap
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(cur), &out); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if _, ok := out.Data["drop-me"]; ok {
+		t.Fatalf("expected the dropped key to be removed, got data: %v", out.Data)
+	}
+}
+
+// TestCreateOrPatchUnstructuredSucceeds addresses the doc comment's claim
+// that the two-way patch path falls back to a plain JSON merge patch for
+// types like unstructured.Unstructured that don't carry strategic merge
+// patch struct tags: whether or not CreateTwoWayMergePatch itself errors for
+// Unstructured, CreateOrPatch must still succeed end-to-end and produce the
+// expected result.
+func TestCreateOrPatchUnstructuredSucceeds(t *testing.T) {
+	cur := &unstructured.Unstructured{}
+	cur.SetAPIVersion("v1")
+	cur.SetKind("ConfigMap")
+	cur.SetNamespace("default")
+	cur.SetName("web")
+	if err := unstructured.SetNestedField(cur.Object, "v", "data", "k"); err != nil {
+		t.Fatalf("set nested field: %v", err)
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(cur).Build()
+
+	out, verb, err := CreateOrPatch(context.Background(), c, client.ObjectKeyFromObject(cur), func(obj *unstructured.Unstructured) error {
+		return unstructured.SetNestedField(obj.Object, "v2", "data", "k")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verb != kutil.VerbPatched {
+		t.Fatalf("expected VerbPatched, got %v", verb)
+	}
+	got, _, err := unstructured.NestedString(out.Object, "data", "k")
+	if err != nil {
+		t.Fatalf("read nested field: %v", err)
+	}
+	if got != "v2" {
+		t.Fatalf("expected patched value %q, got %q", "v2", got)
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright The Kmodules Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kutil
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// PatchMode selects the strategy the CreateOrPatch* and Patch*Object helpers
+// use to compute and send a patch to the API server.
+type PatchMode string
+
+const (
+	// StrategicMerge computes a two-way strategic merge patch between the
+	// current and the modified object. This is the default and matches the
+	// historical behavior of the CreateOrPatch* helpers.
+	StrategicMerge PatchMode = "StrategicMerge"
+	// MergePatch computes a plain JSON merge patch instead of a strategic
+	// merge patch. Useful for types that don't carry strategic merge patch
+	// metadata, such as most CRDs.
+	MergePatch PatchMode = "MergePatch"
+	// ServerSideApply sends the modified object as a Server-Side Apply patch
+	// (types.ApplyPatchType) under FieldManager, letting the API server own
+	// the merge instead of computing one locally.
+	ServerSideApply PatchMode = "ServerSideApply"
+	// ThreeWayMergePatch computes a three-way strategic merge patch from the
+	// LastAppliedConfigAnnotation on the current object, the modified object,
+	// and the current object, exactly like `kubectl apply`. Unlike
+	// StrategicMerge, this correctly removes fields the caller stopped
+	// setting. The modified object's JSON is written back into
+	// LastAppliedConfigAnnotation on every successful create or patch.
+	ThreeWayMergePatch PatchMode = "ThreeWayMergePatch"
+)
+
+// LastAppliedConfigAnnotation is the annotation kubectl apply uses to record
+// the last configuration it applied, so it can diff against it on the next
+// apply. ThreeWayMergePatch reuses it for the same purpose.
+const LastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// PatchOptions controls how the CreateOrPatch* and Patch*Object helpers talk
+// to the API server. The zero value requests a two-way StrategicMerge patch,
+// matching the helpers' historical behavior.
+type PatchOptions struct {
+	// Mode selects the patch strategy. Defaults to StrategicMerge when unset.
+	Mode PatchMode
+	// FieldManager identifies the actor applying the patch. Required when
+	// Mode is ServerSideApply.
+	FieldManager string
+	// Force allows a Server-Side Apply patch to take ownership of fields
+	// currently owned by other field managers. Only meaningful when Mode is
+	// ServerSideApply.
+	Force bool
+}
+
+// PatchType returns the types.PatchType that corresponds to o.Mode, defaulting
+// to a strategic merge patch.
+func (o PatchOptions) PatchType() types.PatchType {
+	switch o.Mode {
+	case MergePatch:
+		return types.MergePatchType
+	case ServerSideApply:
+		return types.ApplyPatchType
+	default:
+		return types.StrategicMergePatchType
+	}
+}
+
+// ToMetaV1 returns the metav1.PatchOptions to send alongside o.PatchType() so
+// FieldManager/Force actually reach the API server. Force is only set for
+// ServerSideApply: the API server rejects it on every other patch type.
+func (o PatchOptions) ToMetaV1() metav1.PatchOptions {
+	opts := metav1.PatchOptions{FieldManager: o.FieldManager}
+	if o.Mode == ServerSideApply {
+		opts.Force = &o.Force
+	}
+	return opts
+}
+
+// MergePatchOptions returns opts[0], or the zero PatchOptions if opts is
+// empty. Every CreateOrPatch*/Patch*Object helper in this module takes its
+// PatchOptions as a variadic final argument so callers can omit it entirely;
+// this is the shared implementation of "take the first one, or the default".
+func MergePatchOptions(opts ...PatchOptions) PatchOptions {
+	if len(opts) == 0 {
+		return PatchOptions{}
+	}
+	return opts[0]
+}
@@ -0,0 +1,38 @@
+/*
+Copyright The Kmodules Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kutil
+
+import "testing"
+
+func TestPatchOptionsToMetaV1(t *testing.T) {
+	o := PatchOptions{Mode: ServerSideApply, FieldManager: "my-controller", Force: true}
+	opts := o.ToMetaV1()
+	if opts.FieldManager != "my-controller" {
+		t.Fatalf("expected FieldManager to be carried through, got %q", opts.FieldManager)
+	}
+	if opts.Force == nil || !*opts.Force {
+		t.Fatalf("expected Force to be set true for ServerSideApply, got %v", opts.Force)
+	}
+}
+
+func TestPatchOptionsToMetaV1OmitsForceOutsideServerSideApply(t *testing.T) {
+	o := PatchOptions{Mode: ThreeWayMergePatch, FieldManager: "my-controller", Force: true}
+	opts := o.ToMetaV1()
+	if opts.Force != nil {
+		t.Fatalf("expected Force to be omitted outside ServerSideApply, got %v", *opts.Force)
+	}
+}